@@ -0,0 +1,38 @@
+package main
+
+import "fmt"
+
+// bitDepth selects the sample format used for -export's final PCM write:
+// 16-bit integer, or 32-bit float straight through (no lossy truncation).
+// Only WAV output honours 32f; MP3 output is always encoded from 16-bit
+// integer PCM. It has no effect on interactive playback, which always runs through
+// beep/speaker's float64 pipeline.
+type bitDepth int
+
+const (
+	bitDepth16  bitDepth = 16
+	bitDepth32F bitDepth = 32
+)
+
+// String implements flag.Value.
+func (b *bitDepth) String() string {
+	switch *b {
+	case bitDepth32F:
+		return "32f"
+	default:
+		return "16"
+	}
+}
+
+// Set implements flag.Value.
+func (b *bitDepth) Set(s string) error {
+	switch s {
+	case "16":
+		*b = bitDepth16
+	case "32f":
+		*b = bitDepth32F
+	default:
+		return fmt.Errorf("bit-depth must be %q or %q", "16", "32f")
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"math"
+
+	"github.com/faiface/beep"
+)
+
+// crossfadeLooper streams [start, end) of an underlying seekable streamer on
+// repeat, crossfading the tail of each pass into the head of the next using
+// an equal-power curve so the loop boundary doesn't click. The mix itself
+// runs in float32, like the rest of the pipeline's offline processing; it
+// only widens back out to float64 at Stream's return, since that's the
+// type beep.Streamer (and so beep/speaker) requires.
+type crossfadeLooper struct {
+	streamer     beep.StreamSeekCloser
+	start, end   int
+	crossfadeLen int
+	head         [][2]float32 // pre-buffered first crossfadeLen samples of the loop
+	pos          int          // position within [start, end) of the next sample to stream
+	fadeIdx      int          // index into head during the crossfade window
+}
+
+// newCrossfadeLooper returns a streamer that loops [start, end) of streamer,
+// crossfading crossfadeSamples of tail into head on every iteration.
+// crossfadeSamples is clamped to at most half the loop length.
+func newCrossfadeLooper(streamer beep.StreamSeekCloser, start, end, crossfadeSamples int) (*crossfadeLooper, error) {
+	if max := (end - start) / 2; crossfadeSamples > max {
+		crossfadeSamples = max
+	}
+
+	cl := &crossfadeLooper{
+		streamer:     streamer,
+		start:        start,
+		end:          end,
+		crossfadeLen: crossfadeSamples,
+		pos:          start,
+	}
+
+	if err := cl.rebufferHead(); err != nil {
+		return nil, err
+	}
+	return cl, nil
+}
+
+// rebufferHead re-reads cl.crossfadeLen samples from cl.start into cl.head,
+// then restores the streamer's position to cl.pos. It must be called
+// whenever cl.start changes, since head was sampled against the old start
+// and would otherwise blend stale audio into every subsequent crossfade.
+func (cl *crossfadeLooper) rebufferHead() error {
+	if cl.crossfadeLen == 0 {
+		return nil
+	}
+
+	if err := cl.streamer.Seek(cl.start); err != nil {
+		return err
+	}
+	headF64 := make([][2]float64, cl.crossfadeLen)
+	n, _ := cl.streamer.Stream(headF64)
+	cl.head = make([][2]float32, n)
+	for i := 0; i < n; i++ {
+		cl.head[i] = [2]float32{float32(headF64[i][0]), float32(headF64[i][1])}
+	}
+
+	return cl.streamer.Seek(cl.pos)
+}
+
+// equalPowerFade returns the (fadeOut, fadeIn) gains for t in [0,1].
+func equalPowerFade(t float32) (fadeOut, fadeIn float32) {
+	angle := math.Pi / 2 * float64(t)
+	fadeOut = float32(math.Cos(angle))
+	fadeIn = float32(math.Sin(angle))
+	return
+}
+
+func (cl *crossfadeLooper) Stream(samples [][2]float64) (n int, ok bool) {
+	fadeStart := cl.end - cl.crossfadeLen
+
+	for n < len(samples) {
+		if cl.crossfadeLen > 0 && cl.pos >= fadeStart && cl.pos < cl.end {
+			var tailSample [1][2]float64
+			buf := tailSample[:]
+			m, tok := cl.streamer.Stream(buf)
+			if !tok || m == 0 {
+				break
+			}
+
+			t := float32(cl.pos-fadeStart) / float32(cl.crossfadeLen)
+			fadeOut, fadeIn := equalPowerFade(t)
+			head := cl.head[cl.fadeIdx%len(cl.head)]
+			tail := [2]float32{float32(buf[0][0]), float32(buf[0][1])}
+
+			mixed := [2]float32{
+				tail[0]*fadeOut + head[0]*fadeIn,
+				tail[1]*fadeOut + head[1]*fadeIn,
+			}
+			samples[n][0] = float64(mixed[0])
+			samples[n][1] = float64(mixed[1])
+
+			cl.fadeIdx++
+			cl.pos++
+			n++
+
+			if cl.pos >= cl.end {
+				if err := cl.streamer.Seek(cl.start + cl.crossfadeLen); err != nil {
+					return n, false
+				}
+				cl.pos = cl.start + cl.crossfadeLen
+				cl.fadeIdx = 0
+			}
+			continue
+		}
+
+		want := fadeStart - cl.pos
+		if cl.crossfadeLen == 0 {
+			want = cl.end - cl.pos
+		}
+		if room := len(samples) - n; want > room {
+			want = room
+		}
+		if want <= 0 {
+			want = 1
+		}
+
+		chunk := samples[n : n+want]
+		m, cok := cl.streamer.Stream(chunk)
+		if !cok || m == 0 {
+			break
+		}
+		n += m
+		cl.pos += m
+
+		if cl.crossfadeLen == 0 && cl.pos >= cl.end {
+			if err := cl.streamer.Seek(cl.start); err != nil {
+				return n, false
+			}
+			cl.pos = cl.start
+		}
+	}
+
+	return n, n > 0
+}
+
+func (cl *crossfadeLooper) Err() error {
+	return cl.streamer.Err()
+}
+
+// NudgeStart shifts the loop start by delta samples (may be negative),
+// clamped so the loop never collapses below its crossfade length, and
+// re-buffers cl.head against the new start so crossfades don't keep
+// blending in audio sampled from the old start position.
+func (cl *crossfadeLooper) NudgeStart(delta int) error {
+	cl.start += delta
+	if cl.start < 0 {
+		cl.start = 0
+	}
+	if max := cl.end - cl.crossfadeLen - 1; cl.start > max {
+		cl.start = max
+	}
+	if cl.pos < cl.start {
+		cl.pos = cl.start
+	}
+	return cl.rebufferHead()
+}
+
+// NudgeEnd shifts the loop end by delta samples (may be negative), clamped
+// so the loop never collapses below its crossfade length.
+func (cl *crossfadeLooper) NudgeEnd(delta int) {
+	cl.end += delta
+	if min := cl.start + cl.crossfadeLen + 1; cl.end < min {
+		cl.end = min
+	}
+}
+
+// SeekTo moves playback to offset samples into the loop, relative to start.
+func (cl *crossfadeLooper) SeekTo(offset int) error {
+	if offset > cl.end-cl.start-1 {
+		offset = cl.end - cl.start - 1
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if err := cl.streamer.Seek(cl.start + offset); err != nil {
+		return err
+	}
+	cl.pos = cl.start + offset
+	cl.fadeIdx = 0
+	return nil
+}
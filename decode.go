@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/flac"
+	"github.com/faiface/beep/mp3"
+	"github.com/faiface/beep/vorbis"
+	"github.com/faiface/beep/wav"
+)
+
+// openAudioFile opens filePath (a local path or an http(s):// URL), sniffs
+// its format from the leading bytes rather than trusting the extension, and
+// decodes it with the matching beep decoder.
+//
+// MIDI is intentionally not supported: beep has no MIDI decoder, and
+// synthesizing one is out of scope here.
+//
+// .webm is also not handled: beep/vorbis only decodes raw Ogg framing, and
+// WebM is a separate EBML/Matroska container that would need its own demuxer
+// even when the audio payload inside is Vorbis or Opus. Only true Ogg-muxed
+// files (.ogg/.oga) are sniffed and decoded here.
+func openAudioFile(filePath string) (beep.StreamSeekCloser, beep.Format, error) {
+	file, isTemp, err := openReadSeeker(filePath)
+	if err != nil {
+		return nil, beep.Format{}, err
+	}
+
+	var (
+		streamer beep.StreamSeekCloser
+		format   beep.Format
+	)
+
+	switch sniffFormat(file) {
+	case formatWAV:
+		streamer, format, err = wav.Decode(file)
+	case formatMP3:
+		streamer, format, err = mp3.Decode(file)
+	case formatFLAC:
+		streamer, format, err = flac.Decode(file)
+	case formatOgg:
+		streamer, format, err = vorbis.Decode(file)
+	default:
+		file.Close()
+		return nil, beep.Format{}, fmt.Errorf("unsupported or unrecognized audio format")
+	}
+
+	if err != nil {
+		file.Close()
+		return nil, beep.Format{}, err
+	}
+
+	if isTemp {
+		streamer = &tempFileStreamer{StreamSeekCloser: streamer, path: file.Name()}
+	}
+	return streamer, format, nil
+}
+
+// openReadSeeker opens filePath for reading. http(s):// URLs are downloaded
+// into a temp file first, since the loop detector and decoders need to seek;
+// isTemp tells the caller the returned file's path must be removed once the
+// decoder built on top of it is closed.
+func openReadSeeker(filePath string) (file *os.File, isTemp bool, err error) {
+	if strings.HasPrefix(filePath, "http://") || strings.HasPrefix(filePath, "https://") {
+		file, err = downloadToTempFile(filePath)
+		return file, true, err
+	}
+	file, err = os.Open(filePath)
+	return file, false, err
+}
+
+// downloadToTempFile streams url's body into a temp file and returns it
+// seeked back to the start.
+func downloadToTempFile(url string) (*os.File, error) {
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	tmp, err := os.CreateTemp("", "audio-looper-*")
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	return tmp, nil
+}
+
+// tempFileStreamer wraps a decoded streamer backed by a downloaded temp
+// file, removing that file once the streamer is closed.
+type tempFileStreamer struct {
+	beep.StreamSeekCloser
+	path string
+}
+
+func (t *tempFileStreamer) Close() error {
+	err := t.StreamSeekCloser.Close()
+	os.Remove(t.path)
+	return err
+}
+
+type audioFormat int
+
+const (
+	formatUnknown audioFormat = iota
+	formatWAV
+	formatMP3
+	formatFLAC
+	formatOgg
+)
+
+// sniffFormat reads the leading bytes of r to identify the container
+// format by magic number, then rewinds r so decoding starts from the top.
+func sniffFormat(r io.ReadSeeker) audioFormat {
+	header := make([]byte, 12)
+	n, _ := io.ReadFull(r, header)
+	header = header[:n]
+	r.Seek(0, io.SeekStart)
+
+	switch {
+	case len(header) >= 12 && string(header[0:4]) == "RIFF" && string(header[8:12]) == "WAVE":
+		return formatWAV
+	case len(header) >= 4 && string(header[0:4]) == "fLaC":
+		return formatFLAC
+	case len(header) >= 4 && string(header[0:4]) == "OggS":
+		return formatOgg
+	case len(header) >= 3 && string(header[0:3]) == "ID3":
+		return formatMP3
+	case len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0:
+		return formatMP3
+	default:
+		return formatUnknown
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/wav"
+	"github.com/viert/lame"
+)
+
+// exportLoop renders the loop [start, end) of streamer, repeated repeats
+// times (crossfaded if crossfadeSamples > 0), and writes it to outPath as
+// WAV or MP3 based on its extension. Samples are kept in float32 until the
+// final write, only truncating to int16 there if depth is bitDepth16 or the
+// output is MP3 (MP3 is always encoded from int16 PCM, whatever depth is); a
+// bitDepth32F WAV export writes IEEE float samples straight through. If
+// fadeOutTail is true, a linear fade is applied over the final repeat so
+// the render doesn't end on a hard cut.
+func exportLoop(streamer beep.StreamSeekCloser, format beep.Format, start, end, crossfadeSamples, repeats int, outPath string, fadeOutTail bool, depth bitDepth) error {
+	if repeats < 1 {
+		return fmt.Errorf("repeats must be at least 1")
+	}
+
+	looper, err := newCrossfadeLooper(streamer, start, end, crossfadeSamples)
+	if err != nil {
+		return err
+	}
+
+	// Every pass after the first resumes at start+crossfade, so it is that
+	// much shorter than the first.
+	loopLen := end - start
+	lastLen := loopLen
+	if repeats > 1 {
+		lastLen = loopLen - looper.crossfadeLen
+	}
+	total := loopLen + (repeats-1)*(loopLen-looper.crossfadeLen)
+	samples := make([][2]float32, 0, total)
+	buffer := make([][2]float64, 1024)
+
+	for len(samples) < total {
+		n, ok := looper.Stream(buffer)
+		if !ok || n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			samples = append(samples, [2]float32{float32(buffer[i][0]), float32(buffer[i][1])})
+		}
+	}
+	if len(samples) > total {
+		samples = samples[:total]
+	}
+
+	if fadeOutTail {
+		applyLinearFadeOut(samples[len(samples)-lastLen:])
+	}
+
+	out, err := os.Create(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	switch {
+	case strings.HasSuffix(outPath, ".wav") && depth == bitDepth32F:
+		return encodeWAVFloat32(out, samples, format)
+	case strings.HasSuffix(outPath, ".wav"):
+		format16 := format
+		format16.Precision = 2
+		return wav.Encode(out, &sliceStreamer{samples: samples}, format16)
+	case strings.HasSuffix(outPath, ".mp3"):
+		return encodeMP3(out, &sliceStreamer{samples: samples}, format)
+	default:
+		return fmt.Errorf("unsupported export format: %s", outPath)
+	}
+}
+
+// applyLinearFadeOut ramps samples down to silence linearly in place.
+func applyLinearFadeOut(samples [][2]float32) {
+	n := len(samples)
+	for i := range samples {
+		gain := float32(1 - float64(i)/float64(n))
+		samples[i][0] *= gain
+		samples[i][1] *= gain
+	}
+}
+
+// encodeMP3 encodes rendered to out as MP3 using go-lame.
+func encodeMP3(out *os.File, rendered beep.Streamer, format beep.Format) error {
+	enc := lame.Init()
+	defer enc.Close()
+
+	enc.SetInSamplerate(int(format.SampleRate))
+	enc.SetNumChannels(format.NumChannels)
+	if ret := enc.InitParams(); ret < 0 {
+		return fmt.Errorf("lame: InitParams failed with code %d", ret)
+	}
+
+	buffer := make([][2]float64, 1024)
+	pcm := make([]int16, 0, 1024*2)
+	for {
+		n, ok := rendered.Stream(buffer)
+		if !ok || n == 0 {
+			break
+		}
+		pcm = pcm[:0]
+		for i := 0; i < n; i++ {
+			for ch := 0; ch < format.NumChannels; ch++ {
+				pcm = append(pcm, int16(buffer[i][ch]*32767))
+			}
+		}
+		if _, err := out.Write(enc.Encode(int16ToBytes(pcm))); err != nil {
+			return err
+		}
+	}
+	_, err := out.Write(enc.Flush())
+	return err
+}
+
+// int16ToBytes packs a slice of int16 PCM samples into little-endian bytes.
+func int16ToBytes(pcm []int16) []byte {
+	out := make([]byte, len(pcm)*2)
+	for i, s := range pcm {
+		out[i*2] = byte(s)
+		out[i*2+1] = byte(s >> 8)
+	}
+	return out
+}
+
+// encodeWAVFloat32 writes samples to out as a WAVE_FORMAT_IEEE_FLOAT WAV
+// file, so export at -bit-depth 32f never truncates to integer PCM.
+func encodeWAVFloat32(out *os.File, samples [][2]float32, format beep.Format) error {
+	const bitsPerSample = 32
+	numChannels := format.NumChannels
+	byteRate := int(format.SampleRate) * numChannels * bitsPerSample / 8
+	blockAlign := numChannels * bitsPerSample / 8
+	dataSize := len(samples) * blockAlign
+
+	header := make([]byte, 0, 44)
+	header = append(header, []byte("RIFF")...)
+	header = appendUint32(header, uint32(36+dataSize))
+	header = append(header, []byte("WAVE")...)
+	header = append(header, []byte("fmt ")...)
+	header = appendUint32(header, 16)
+	header = appendUint16(header, 3) // WAVE_FORMAT_IEEE_FLOAT
+	header = appendUint16(header, uint16(numChannels))
+	header = appendUint32(header, uint32(format.SampleRate))
+	header = appendUint32(header, uint32(byteRate))
+	header = appendUint16(header, uint16(blockAlign))
+	header = appendUint16(header, bitsPerSample)
+	header = append(header, []byte("data")...)
+	header = appendUint32(header, uint32(dataSize))
+
+	if _, err := out.Write(header); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 4)
+	for _, s := range samples {
+		for ch := 0; ch < numChannels; ch++ {
+			binary.LittleEndian.PutUint32(buf, math.Float32bits(s[ch%2]))
+			if _, err := out.Write(buf); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	var buf [2]byte
+	binary.LittleEndian.PutUint16(buf[:], v)
+	return append(b, buf[:]...)
+}
+
+// sliceStreamer streams a fixed, already-rendered float32 slice as a
+// beep.Streamer, converting to float64 only at this final boundary.
+type sliceStreamer struct {
+	samples [][2]float32
+	pos     int
+}
+
+func (s *sliceStreamer) Stream(samples [][2]float64) (n int, ok bool) {
+	if s.pos >= len(s.samples) {
+		return 0, false
+	}
+	for n < len(samples) && s.pos < len(s.samples) {
+		samples[n][0] = float64(s.samples[s.pos][0])
+		samples[n][1] = float64(s.samples[s.pos][1])
+		n++
+		s.pos++
+	}
+	return n, true
+}
+
+func (s *sliceStreamer) Err() error {
+	return nil
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/faiface/beep"
+)
+
+// LoopFinder searches a decoded audio buffer for the best-sounding loop
+// point using short-time autocorrelation: it looks for the period P that
+// makes the tail of the track look as similar as possible to the region
+// exactly P samples earlier.
+type LoopFinder struct {
+	// Window is the number of samples compared at each candidate period
+	// (e.g. one second's worth of samples).
+	Window int
+	// MinPeriod and MaxPeriod bound the candidate loop length P, in samples.
+	MinPeriod int
+	MaxPeriod int
+	// Threshold is the minimum normalized correlation score (0..1) a
+	// candidate must reach to be accepted.
+	Threshold float64
+}
+
+// NewLoopFinder returns a LoopFinder configured with sensible defaults for
+// sampleRate: a 1s comparison window and a period search range of 0.5s to 30s.
+func NewLoopFinder(sampleRate int) *LoopFinder {
+	return &LoopFinder{
+		Window:    sampleRate,
+		MinPeriod: sampleRate / 2,
+		MaxPeriod: sampleRate * 30,
+		Threshold: 0.6,
+	}
+}
+
+// Find decodes the entire stream into a mono float32 buffer and returns the
+// [start, end) sample range of the best loop candidate. If no candidate
+// clears lf.Threshold, it falls back to looping the whole decoded file.
+// The autocorrelation runs directly on that float32 buffer, with no
+// intermediate float64 copy.
+func (lf *LoopFinder) Find(streamer beep.Streamer) (start, end int) {
+	samples := decodeMono(streamer)
+	n := len(samples)
+	if n == 0 {
+		return 0, 0
+	}
+
+	window := lf.Window
+	if window > n {
+		window = n
+	}
+
+	minPeriod := lf.MinPeriod
+	maxPeriod := lf.MaxPeriod
+	if maxPeriod > n-window {
+		maxPeriod = n - window
+	}
+	if minPeriod < 1 {
+		minPeriod = 1
+	}
+	if minPeriod > maxPeriod {
+		return 0, n
+	}
+
+	bestPeriod, bestScore := findBestPeriod(samples, n, window, minPeriod, maxPeriod)
+
+	if bestPeriod == 0 || float64(bestScore) < lf.Threshold {
+		return 0, n
+	}
+
+	end = n
+	start = end - bestPeriod
+	start = snapToZeroCrossing(samples, start, samples[end-1] >= 0)
+	return start, end
+}
+
+// coarseFactor is the decimation factor used to shortlist candidate periods
+// before refining at full resolution. refineMargin is how far around each
+// shortlisted coarse candidate (in full-resolution samples) the refinement
+// pass searches. maxCandidates bounds how many shortlisted periods get
+// refined.
+const (
+	coarseFactor    = 64
+	refineMargin    = coarseFactor * 2
+	maxCandidates   = 8
+	coarseSkipBelow = coarseFactor * 4 // below this range, just brute force directly
+)
+
+// findBestPeriod searches [minPeriod, maxPeriod] for the period with the
+// highest correlationAt score. A brute-force scan here is O((maxPeriod-
+// minPeriod) * window): for a typical song (44.1kHz, up to a 30s max
+// period) that's on the order of 10^11 floating point ops, many minutes of
+// work. Instead, when the range is large, run a coarse pass on a decimated
+// (and so much cheaper to score) copy of samples to shortlist a handful of
+// candidate periods, then refine only those at full resolution.
+func findBestPeriod(samples []float32, n, window, minPeriod, maxPeriod int) (int, float32) {
+	if maxPeriod-minPeriod < coarseSkipBelow {
+		return bruteForceBestPeriod(samples, n, window, minPeriod, maxPeriod)
+	}
+
+	coarse := decimate(samples, coarseFactor)
+	coarseN := len(coarse)
+	coarseWindow := window / coarseFactor
+	if coarseWindow < 1 {
+		coarseWindow = 1
+	}
+	coarseMin := minPeriod / coarseFactor
+	if coarseMin < 1 {
+		coarseMin = 1
+	}
+	coarseMax := maxPeriod / coarseFactor
+	if coarseMax > coarseN-coarseWindow {
+		coarseMax = coarseN - coarseWindow
+	}
+	if coarseMin > coarseMax {
+		return bruteForceBestPeriod(samples, n, window, minPeriod, maxPeriod)
+	}
+
+	candidates := topPeriodsByScore(coarse, coarseN, coarseWindow, coarseMin, coarseMax, maxCandidates)
+
+	bestPeriod, bestScore := 0, float32(0)
+	for _, c := range candidates {
+		center := c * coarseFactor
+		lo := center - refineMargin
+		if lo < minPeriod {
+			lo = minPeriod
+		}
+		hi := center + refineMargin
+		if hi > maxPeriod {
+			hi = maxPeriod
+		}
+		if period, score := bruteForceBestPeriod(samples, n, window, lo, hi); score > bestScore {
+			bestScore = score
+			bestPeriod = period
+		}
+	}
+	return bestPeriod, bestScore
+}
+
+// bruteForceBestPeriod scans every period in [minPeriod, maxPeriod] and
+// returns the one with the highest correlationAt score.
+func bruteForceBestPeriod(samples []float32, n, window, minPeriod, maxPeriod int) (int, float32) {
+	bestScore := float32(0)
+	bestPeriod := 0
+	for period := minPeriod; period <= maxPeriod; period++ {
+		score := correlationAt(samples, n, window, period)
+		if score > bestScore {
+			bestScore = score
+			bestPeriod = period
+		}
+	}
+	return bestPeriod, bestScore
+}
+
+// topPeriodsByScore scores every period in [minPeriod, maxPeriod] and
+// returns up to k of them, highest-scoring first.
+func topPeriodsByScore(samples []float32, n, window, minPeriod, maxPeriod, k int) []int {
+	type scoredPeriod struct {
+		period int
+		score  float32
+	}
+	scored := make([]scoredPeriod, 0, maxPeriod-minPeriod+1)
+	for period := minPeriod; period <= maxPeriod; period++ {
+		scored = append(scored, scoredPeriod{period, correlationAt(samples, n, window, period)})
+	}
+	sort.Slice(scored, func(i, j int) bool { return scored[i].score > scored[j].score })
+
+	if len(scored) > k {
+		scored = scored[:k]
+	}
+	periods := make([]int, len(scored))
+	for i, s := range scored {
+		periods[i] = s.period
+	}
+	return periods
+}
+
+// decimate downsamples samples by averaging non-overlapping blocks of
+// factor samples, producing a cheaper-to-score buffer for the coarse pass.
+func decimate(samples []float32, factor int) []float32 {
+	out := make([]float32, len(samples)/factor)
+	for i := range out {
+		var sum float32
+		for _, s := range samples[i*factor : (i+1)*factor] {
+			sum += s
+		}
+		out[i] = sum / float32(factor)
+	}
+	return out
+}
+
+// correlationAt computes the normalized cross-correlation between the
+// trailing window of samples ending at n and the equally-sized window
+// ending period samples earlier, entirely in float32.
+func correlationAt(samples []float32, n, window, period int) float32 {
+	a := samples[n-window:]
+	b := samples[n-window-period : n-period]
+
+	var dot, energyA, energyB float32
+	for i := 0; i < window; i++ {
+		dot += a[i] * b[i]
+		energyA += a[i] * a[i]
+		energyB += b[i] * b[i]
+	}
+
+	denom := float32(math.Sqrt(float64(energyA * energyB)))
+	if denom == 0 {
+		return 0
+	}
+	return dot / denom
+}
+
+// snapToZeroCrossing walks backwards from idx to the nearest zero crossing
+// whose slope sign matches wantPositive, to avoid an audible click at the
+// loop boundary.
+func snapToZeroCrossing(samples []float32, idx int, wantPositive bool) int {
+	for i := idx; i > 0; i-- {
+		crossesUp := samples[i-1] < 0 && samples[i] >= 0
+		crossesDown := samples[i-1] >= 0 && samples[i] < 0
+		if (wantPositive && crossesUp) || (!wantPositive && crossesDown) {
+			return i
+		}
+	}
+	return idx
+}
+
+// decodeMono reads streamer to completion and downmixes every frame to a
+// single float32 channel, matching the float32 mixing crossfadeLooper does
+// internally (beep/speaker itself still streams float64 end-to-end).
+func decodeMono(streamer beep.Streamer) []float32 {
+	buffer := make([][2]float64, 1024)
+	samples := make([]float32, 0, 1<<16)
+
+	for {
+		n, ok := streamer.Stream(buffer)
+		if !ok || n == 0 {
+			break
+		}
+		for i := 0; i < n; i++ {
+			samples = append(samples, float32((buffer[i][0]+buffer[i][1])/2))
+		}
+	}
+	return samples
+}
@@ -2,18 +2,30 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/faiface/beep"
-	"github.com/faiface/beep/flac"
-	"github.com/faiface/beep/mp3"
-	"github.com/faiface/beep/wav"
-	"github.com/hajimehoshi/oto"
+	"github.com/faiface/beep/effects"
+	"github.com/faiface/beep/speaker"
 )
 
 func main() {
+	crossfadeSeconds := flag.Float64("crossfade", 0, "crossfade the loop boundary over this many seconds (0 disables crossfading)")
+	exportPath := flag.String("export", "", "render the detected loop to this WAV or MP3 file instead of playing it interactively")
+	repeats := flag.Int("repeats", 1, "number of times to repeat the loop when exporting")
+	fadeOutTail := flag.Bool("fade-out-tail", false, "apply a linear fade-out over the final repeat when exporting")
+	depth := bitDepth16
+	flag.Var(&depth, "bit-depth", "sample format for -export output: 16 or 32f (interactive playback always goes through beep's float64 pipeline)")
+	loopWindow := flag.Float64("loop-window", 1.0, "loop detection: comparison window size in seconds")
+	loopMinPeriod := flag.Float64("loop-min-period", 0.5, "loop detection: minimum candidate loop length in seconds")
+	loopMaxPeriod := flag.Float64("loop-max-period", 30.0, "loop detection: maximum candidate loop length in seconds")
+	loopThreshold := flag.Float64("loop-threshold", 0.6, "loop detection: minimum correlation score (0-1) to accept a candidate")
+	flag.Parse()
+
 	reader := bufio.NewReader(os.Stdin)
 
 	// Load audio file
@@ -30,120 +42,44 @@ func main() {
 	defer streamer.Close()
 
 	// Automatically detect loopable segment
-	start, end := detectLoopSegment(streamer)
-	fmt.Printf("Detected loop segment from %v to %v\n", start, end)
-
-	// Initialize audio player context
-	sampleRate := int(format.SampleRate)
-	context, err := oto.NewContext(sampleRate, format.NumChannels, 2, 4096)
-	if err != nil {
-		fmt.Println("Error initializing audio player:", err)
+	loopFinder := NewLoopFinder(int(format.SampleRate))
+	loopFinder.Window = int(*loopWindow * float64(format.SampleRate))
+	loopFinder.MinPeriod = int(*loopMinPeriod * float64(format.SampleRate))
+	loopFinder.MaxPeriod = int(*loopMaxPeriod * float64(format.SampleRate))
+	loopFinder.Threshold = *loopThreshold
+	start, end := loopFinder.Find(streamer)
+	if err := streamer.Seek(0); err != nil {
+		fmt.Println("Error rewinding audio file:", err)
 		return
 	}
-	defer context.Close()
-
-	player := context.NewPlayer()
-	defer player.Close()
+	fmt.Printf("Detected loop segment from %v to %v\n", start, end)
 
-	// Loop the detected segment seamlessly
-	seamlessLoop(player, streamer, start, end, format)
-}
+	crossfadeSamples := int(*crossfadeSeconds * float64(format.SampleRate))
 
-// openAudioFile opens and decodes the audio file.
-func openAudioFile(filePath string) (beep.StreamSeekCloser, beep.Format, error) {
-	file, err := os.Open(filePath)
-	if err != nil {
-		return nil, beep.Format{}, err
+	if *exportPath != "" {
+		if err := exportLoop(streamer, format, start, end, crossfadeSamples, *repeats, *exportPath, *fadeOutTail, depth); err != nil {
+			fmt.Println("Error exporting loop:", err)
+			return
+		}
+		fmt.Println("Exported loop to", *exportPath)
+		return
 	}
 
-	var (
-		streamer beep.StreamSeekCloser
-		format   beep.Format
-	)
-
-	// Detect format based on file extension
-	if strings.HasSuffix(filePath, ".mp3") {
-		streamer, format, err = mp3.Decode(file)
-	} else if strings.HasSuffix(filePath, ".wav") {
-		streamer, format, err = wav.Decode(file)
-	} else if strings.HasSuffix(filePath, ".flac") {
-		streamer, format, err = flac.Decode(file)
-	} else {
-		return nil, beep.Format{}, fmt.Errorf("unsupported audio format")
+	if err := speaker.Init(format.SampleRate, format.SampleRate.N(time.Second/10)); err != nil {
+		fmt.Println("Error initializing speaker:", err)
+		return
 	}
 
+	looper, err := newCrossfadeLooper(streamer, start, end, crossfadeSamples)
 	if err != nil {
-		file.Close()
-		return nil, beep.Format{}, err
+		fmt.Println("Error setting up loop:", err)
+		return
 	}
 
-	return streamer, format, nil
-}
-
-// detectLoopSegment scans the audio stream to find a loopable segment.
-func detectLoopSegment(streamer beep.StreamSeekCloser) (start, end int) {
-	buffer := make([][2]float64, 1024)
-	var threshold float64 = 0.001 // Silence threshold
-	var silenceCount int
+	ctrl := &beep.Ctrl{Streamer: looper, Paused: false}
+	volume := &effects.Volume{Streamer: ctrl, Base: 2, Volume: 0, Silent: false}
+	speaker.Play(volume)
 
-	// Default loop start and end
-	start, end = 0, 0
-	silenceDuration := 44100 / 10 // Duration (in samples) to count as "silence"
-
-	for i := 0; ; i++ {
-		n, ok := streamer.Stream(buffer)
-		if !ok || n == 0 {
-			break
-		}
-
-		// Detect a stretch of silence
-		for j := 0; j < n; j++ {
-			amp := (buffer[j][0] + buffer[j][1]) / 2
-			if amp < threshold {
-				silenceCount++
-			} else {
-				// Reset silence count if sound is detected
-				if silenceCount > silenceDuration {
-					start = end // Update loop start to previous end
-					end = i*1024 + j
-				}
-				silenceCount = 0
-			}
-		}
-	}
-	return start, end
-}
-
-// seamlessLoop plays a segment of the audio in a loop without pauses.
-func seamlessLoop(player *oto.Player, originalStreamer beep.StreamSeekCloser, start, end int, format beep.Format) {
-	for {
-		// Seek to loop start
-		originalStreamer.Seek(start)
-		playAudioSegment(player, originalStreamer, end-start, format)
-	}
+	runControlREPL(reader, ctrl, volume, looper, format)
 }
 
-// playAudioSegment plays a specific segment of the audio.
-func playAudioSegment(player *oto.Player, streamer beep.Streamer, segmentLength int, format beep.Format) {
-	buffer := make([][2]float64, 1024)
-	samplesPlayed := 0
-
-	for samplesPlayed < segmentLength {
-		n, ok := streamer.Stream(buffer)
-		if !ok || n == 0 {
-			break
-		}
-
-		// Convert buffer data to byte format and write to player
-		writeBuffer := make([]byte, n*4) // 2 channels * 2 bytes per sample
-		for i := 0; i < n; i++ {
-			for ch := 0; ch < 2; ch++ {
-				sample := int16(buffer[i][ch] * 32767)
-				writeBuffer[i*4+ch*2] = byte(sample)
-				writeBuffer[i*4+ch*2+1] = byte(sample >> 8)
-			}
-		}
-		player.Write(writeBuffer)
-		samplesPlayed += n
-	}
-}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/faiface/beep"
+	"github.com/faiface/beep/effects"
+	"github.com/faiface/beep/speaker"
+)
+
+// dbStep is how much each +/- keypress changes the output level.
+const dbStep = 3.0
+
+// nudgeStep is how far [ and ] move the loop boundary per keypress.
+const nudgeStep = 100 * time.Millisecond
+
+// runControlREPL reads single-character commands from reader until the user
+// quits, controlling playback via ctrl, volume and looper. All mutations of
+// shared playback state are wrapped in speaker.Lock/Unlock, since the
+// speaker callback runs on its own goroutine.
+func runControlREPL(reader *bufio.Reader, ctrl *beep.Ctrl, volume *effects.Volume, looper *crossfadeLooper, format beep.Format) {
+	fmt.Println("Controls: [space] pause/resume, +/- volume, [/] nudge loop start/end, s seek, q quit")
+	nudgeSamples := format.SampleRate.N(nudgeStep)
+	volumeStep := dbStep / (20 * math.Log10(volume.Base))
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.TrimSpace(line)
+		if cmd == "" {
+			// A line of just spaces is the pause/resume command.
+			if !strings.Contains(line, " ") {
+				continue
+			}
+			cmd = " "
+		}
+
+		switch cmd[0] {
+		case ' ':
+			speaker.Lock()
+			ctrl.Paused = !ctrl.Paused
+			speaker.Unlock()
+
+		case '+':
+			speaker.Lock()
+			volume.Volume += volumeStep
+			speaker.Unlock()
+
+		case '-':
+			speaker.Lock()
+			volume.Volume -= volumeStep
+			speaker.Unlock()
+
+		case '[':
+			speaker.Lock()
+			err := looper.NudgeStart(-nudgeSamples)
+			speaker.Unlock()
+			if err != nil {
+				fmt.Println("Error nudging loop start:", err)
+			}
+
+		case ']':
+			speaker.Lock()
+			looper.NudgeEnd(nudgeSamples)
+			speaker.Unlock()
+
+		case 's':
+			fmt.Print("Seek to (seconds into loop): ")
+			posLine, err := reader.ReadString('\n')
+			if err != nil {
+				return
+			}
+			seconds, err := strconv.ParseFloat(strings.TrimSpace(posLine), 64)
+			if err != nil {
+				fmt.Println("Invalid position:", err)
+				continue
+			}
+			offset := format.SampleRate.N(time.Duration(seconds * float64(time.Second)))
+			speaker.Lock()
+			err = looper.SeekTo(offset)
+			speaker.Unlock()
+			if err != nil {
+				fmt.Println("Error seeking:", err)
+			}
+
+		case 'q':
+			return
+		}
+	}
+}